@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// cachePath returns where the watch-daemon stores (and the hook looks
+// up) the pre-evaluated dump for a given .envrc, keyed by its content
+// hash so a stale entry can never be served for a changed file.
+func cachePath(config *Config, envrcHash string) string {
+	return filepath.Join(config.CacheDir(), "watch-daemon", envrcHash)
+}
+
+// writeCachedDump/readCachedDump reuse the same gzenv encoding
+// cmd_dump.go uses for `direnv dump` -- it exists precisely to survive
+// arbitrary env values (embedded newlines, binary bytes), which a
+// naive line-based format wouldn't.
+func writeCachedDump(config *Config, envrcHash string, dumped Env) error {
+	path := cachePath(config, envrcHash)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(DetectShell("gzenv").Dump(dumped)), 0644)
+}
+
+func readCachedDump(config *Config, envrcHash string) (Env, bool) {
+	data, err := ioutil.ReadFile(cachePath(config, envrcHash))
+	if err != nil {
+		return nil, false
+	}
+
+	env, err := LoadEnv(string(data))
+	if err != nil {
+		return nil, false
+	}
+
+	return env, true
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+// cache.go stores the watch-daemon's pre-evaluated env via
+// DetectShell("gzenv").Dump/LoadEnv specifically because a naive
+// newline-joined format corrupts on values direnv legitimately
+// produces -- a multi-line export, a PEM cert, etc.
+func TestCachedDumpEncodingSurvivesEmbeddedNewlines(t *testing.T) {
+	env := Env{
+		"SIMPLE": "bar",
+		"MULTILINE": "-----BEGIN CERTIFICATE-----\n" +
+			"totallylegitcertdata\n" +
+			"-----END CERTIFICATE-----",
+	}
+
+	shell := DetectShell("gzenv")
+	if shell == nil {
+		t.Fatal("gzenv shell not found")
+	}
+
+	roundTripped, err := LoadEnv(shell.Dump(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range env {
+		if roundTripped[key] != value {
+			t.Fatalf("round-tripped %s = %q, want %q", key, roundTripped[key], value)
+		}
+	}
+}
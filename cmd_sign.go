@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// `direnv sign`
+var CmdSign = &Cmd{
+	Name: "sign",
+	Desc: "Signs .envrc with the local signing key, printing the public key so it can be shared for `direnv trust-key`",
+	Args: []string{},
+	Action: actionSimple(func(env Env, args []string) (err error) {
+		config, err := LoadConfig(env)
+		if err != nil {
+			return err
+		}
+
+		rc := FindRC(config.WorkDir, config, filesystemFor(config))
+		if rc == nil {
+			return fmt.Errorf("no .envrc found")
+		}
+
+		if err = signPath(rc.path, config); err != nil {
+			return err
+		}
+
+		publicKey, err := publicKeyForSigningKey(config)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(publicKey)
+		return nil
+	}),
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// `direnv trust-key NAME PUBLIC_KEY`
+var CmdTrustKey = &Cmd{
+	Name: "trust-key",
+	Desc: "Adds a public signing key to the trusted keyring, so .envrc.sig files it produced are accepted without a per-machine `direnv allow`",
+	Args: []string{"NAME", "PUBLIC_KEY"},
+	Action: actionSimple(func(env Env, args []string) (err error) {
+		if len(args) < 3 {
+			return fmt.Errorf("trust-key needs a NAME and a PUBLIC_KEY")
+		}
+
+		config, err := LoadConfig(env)
+		if err != nil {
+			return err
+		}
+
+		return trustKey(config, args[1], args[2])
+	}),
+}
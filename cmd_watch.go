@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// `direnv watch MARSHALLED_WATCHES PATH` -- called by the stdlib's
+// watch_file for both plain paths and glob patterns like
+// "config/*.yaml". It folds PATH into MARSHALLED_WATCHES and prints
+// the result, which watch_file re-exports as DIRENV_WATCHES.
+var CmdWatch = &Cmd{
+	Name:    "watch",
+	Desc:    "Registers a path or glob pattern into DIRENV_WATCHES",
+	Args:    []string{"MARSHALLED_WATCHES", "PATH"},
+	Private: true,
+	Action: actionSimple(func(env Env, args []string) (err error) {
+		if len(args) < 3 {
+			return fmt.Errorf("watch needs MARSHALLED_WATCHES and PATH")
+		}
+
+		config, err := LoadConfig(env)
+		if err != nil {
+			return err
+		}
+
+		times := NewFileTimes()
+		times.Unmarshal(args[1])
+
+		path := args[2]
+		if strings.ContainsAny(path, "*?[") {
+			if err = times.UpdateGlob(path, config.WorkDir); err != nil {
+				return err
+			}
+		} else {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(config.WorkDir, path)
+			}
+			times.Update(path)
+		}
+
+		fmt.Println(times.Marshal())
+		return nil
+	}),
+}
@@ -0,0 +1,16 @@
+package main
+
+// `direnv watch-daemon`
+var CmdWatchDaemon = &Cmd{
+	Name:    "watch-daemon",
+	Desc:    "Pre-evaluates .envrc on change so the shell hook can skip bash entirely",
+	Args:    []string{},
+	Private: true,
+	Action: actionSimple(func(env Env, args []string) (err error) {
+		config, err := LoadConfig(env)
+		if err != nil {
+			return err
+		}
+		return RunWatchDaemon(config)
+	}),
+}
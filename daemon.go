@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// watchDaemonSocketPath is where the shell hook looks for a running
+// daemon before falling back to spawning bash itself. It's namespaced
+// by a hash of workDir so a daemon for one project never collides
+// with, or gets torn down by, a daemon for another.
+func watchDaemonSocketPath(workDir string) string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(workDir))
+	name := fmt.Sprintf("direnv.watch-daemon.%x.sock", sum[:8])
+	return filepath.Join(runtimeDir, name)
+}
+
+// RunWatchDaemon subscribes, via inotify (see inotify_linux.go), to the
+// directory containing rc.path and every directory holding a file
+// registered in rc.times. On each event that changes something rc.times
+// tracks, it re-evaluates the .envrc through bash and caches the
+// resulting env keyed by the .envrc's content hash, so that repeated
+// lookups for an unchanged .envrc never have to spawn bash again. It
+// serves those lookups over a Unix socket under XDG_RUNTIME_DIR (or the
+// system temp dir when that is unset).
+func RunWatchDaemon(config *Config) error {
+	rc := FindRC(config.WorkDir, config, filesystemFor(config))
+	if rc == nil {
+		return fmt.Errorf("no .envrc found under %s", config.WorkDir)
+	}
+
+	watcher, err := newWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(rc.path)); err != nil {
+		return err
+	}
+	for path := range rc.times.files {
+		watcher.Add(filepath.Dir(path))
+	}
+	for pattern := range rc.times.globs {
+		watcher.Add(filepath.Dir(filepath.Join(config.WorkDir, pattern)))
+	}
+
+	socketPath := watchDaemonSocketPath(config.WorkDir)
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("a watch-daemon is already running for %s (%s)", config.WorkDir, socketPath)
+	}
+	os.Remove(socketPath) // stale socket left behind by a daemon that didn't shut down cleanly
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	go func() {
+		preEvaluate(rc, config)
+		refreshWatchedTimes(rc, config)
+		for range watcher.Events() {
+			// inotify fires on the whole directory, so a write next to
+			// .envrc that doesn't touch anything we actually track
+			// shouldn't cost a bash re-exec
+			if !rc.times.HasChanged(config.WorkDir) {
+				continue
+			}
+			preEvaluate(rc, config)
+			refreshWatchedTimes(rc, config)
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveWatchDaemonConn(conn, config)
+	}
+}
+
+// refreshWatchedTimes re-records every tracked file's mtime and every
+// tracked glob's signature, so the next HasChanged compares against
+// the state as of this evaluation rather than the daemon's start-up.
+func refreshWatchedTimes(rc *RC, config *Config) {
+	for path := range rc.times.files {
+		rc.times.Update(path)
+	}
+	for pattern := range rc.times.globs {
+		rc.times.UpdateGlob(pattern, config.WorkDir)
+	}
+}
+
+// preEvaluate spawns bash against the real process environment --
+// anything in .envrc that reads ambient PATH/HOME/etc needs to see the
+// same environment a live Load would give it -- and stashes the result
+// in the cache for the hook to pick up. It calls rc.load directly
+// rather than rc.Load, since Load itself now checks the cache first
+// and we specifically want a live evaluation here.
+func preEvaluate(rc *RC, config *Config) {
+	dumped, err := rc.load(config, GetEnv(), nil)
+	if err != nil {
+		return
+	}
+
+	hash, err := legacyFileHash(rc.path, filesystemFor(config))
+	if err != nil {
+		return
+	}
+
+	writeCachedDump(config, hash, dumped)
+}
+
+// serveWatchDaemonConn answers a single request of the form
+// "<envrc-hash>\n" with either "MISS\n" or "HIT\n" followed by the
+// cached, serialized env.
+func serveWatchDaemonConn(conn net.Conn, config *Config) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	hash := strings.TrimSpace(line)
+	dumped, ok := readCachedDump(config, hash)
+	if !ok {
+		fmt.Fprintln(conn, "MISS")
+		return
+	}
+
+	fmt.Fprintln(conn, "HIT")
+	fmt.Fprint(conn, DetectShell("gzenv").Dump(dumped))
+}
+
+// requestCachedEnv is the hook side of the protocol: ask the
+// workDir's daemon for envrcHash and report whether it had something
+// for us.
+func requestCachedEnv(workDir, envrcHash string) (Env, bool) {
+	conn, err := net.Dial("unix", watchDaemonSocketPath(workDir))
+	if err != nil {
+		return nil, false
+	}
+	defer conn.Close()
+
+	fmt.Fprintln(conn, envrcHash)
+
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(status) != "HIT" {
+		return nil, false
+	}
+
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, false
+	}
+
+	cached, err := LoadEnv(string(rest))
+	if err != nil {
+		return nil, false
+	}
+
+	return cached, true
+}
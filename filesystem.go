@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Filesystem abstracts the handful of file operations .envrc discovery
+// and loading need, so they aren't hard-wired to the local disk.
+// localFS is the only implementation today; a readonlyFS for CI or a
+// remote source for team-shared environments could implement the same
+// interface later without touching rc.go.
+type Filesystem interface {
+	Stat(path string) (os.FileInfo, error)
+	Lstat(path string) (os.FileInfo, error)
+	Readlink(path string) (string, error)
+	Open(path string) (io.ReadCloser, error)
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	Chtimes(path string, atime, mtime time.Time) error
+	Walk(root string, fn filepath.WalkFunc) error
+	ReadDir(path string) ([]os.FileInfo, error)
+}
+
+// localFS is a thin passthrough to the os and path/filepath packages.
+type localFS struct{}
+
+func (localFS) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (localFS) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (localFS) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+func (localFS) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (localFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(path, data, perm)
+}
+
+func (localFS) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+func (localFS) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+func (localFS) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+// LocalFS is the Filesystem filesystemFor returns, whatever a Config's
+// FilesystemType says.
+var LocalFS Filesystem = localFS{}
+
+// filesystemFor picks the Filesystem a Config's FilesystemType names.
+// Unknown or empty types fall back to LocalFS.
+func filesystemFor(config *Config) Filesystem {
+	switch config.FilesystemType {
+	case "", "local":
+		return LocalFS
+	default:
+		return LocalFS
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memFS is a minimal Filesystem backed by an in-memory map, used to
+// prove that code built on the Filesystem interface (canonicalizePath,
+// hashDigest) never falls back to touching the real disk.
+type memFS struct {
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func (fs *memFS) Stat(path string) (os.FileInfo, error) {
+	return fs.Lstat(path)
+}
+
+func (fs *memFS) Lstat(path string) (os.FileInfo, error) {
+	if fs.dirs[path] {
+		return fakeFileInfo{name: filepath.Base(path), isDir: true}, nil
+	}
+	data, ok := fs.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return fakeFileInfo{name: filepath.Base(path), size: int64(len(data))}, nil
+}
+
+func (fs *memFS) Readlink(path string) (string, error) {
+	return "", os.ErrInvalid
+}
+
+func (fs *memFS) Open(path string) (io.ReadCloser, error) {
+	data, ok := fs.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (fs *memFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	fs.files[path] = data
+	return nil
+}
+
+func (fs *memFS) Chtimes(path string, atime, mtime time.Time) error {
+	return nil
+}
+
+func (fs *memFS) Walk(root string, fn filepath.WalkFunc) error {
+	return nil
+}
+
+func (fs *memFS) ReadDir(path string) ([]os.FileInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+type fakeFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i fakeFileInfo) Name() string { return i.name }
+func (i fakeFileInfo) Size() int64  { return i.size }
+func (i fakeFileInfo) Mode() os.FileMode {
+	if i.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+func (i fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeFileInfo) IsDir() bool        { return i.isDir }
+func (i fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestHashDigestUsesFilesystemNotLocalDisk(t *testing.T) {
+	fs := &memFS{
+		files: map[string][]byte{
+			"/virtual/.envrc": []byte("export FOO=bar\n"),
+		},
+		dirs: map[string]bool{"/virtual": true},
+	}
+
+	digest, err := hashDigest("/virtual/.envrc", sha256Hasher{}, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := sha256Hasher{}.Sum([]byte("/virtual/.envrc\nexport FOO=bar\n"))
+	if !bytes.Equal(digest, want) {
+		t.Fatalf("hashDigest = % x, want % x", digest, want)
+	}
+
+	if _, err := hashDigest("/virtual/.envrc", sha256Hasher{}, LocalFS); err == nil {
+		t.Fatal("hashDigest against LocalFS unexpectedly found a path that only exists in memFS")
+	}
+}
+
+func TestCanonicalizePathAgainstCustomFilesystem(t *testing.T) {
+	fs := &memFS{
+		files: map[string][]byte{
+			"/virtual/.envrc": []byte("export FOO=bar\n"),
+		},
+		dirs: map[string]bool{"/virtual": true},
+	}
+
+	resolved, err := canonicalizePath("/virtual/.envrc", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != "/virtual/.envrc" {
+		t.Fatalf("canonicalizePath = %q, want %q", resolved, "/virtual/.envrc")
+	}
+}
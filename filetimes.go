@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileTimes tracks the mtimes of individual files, plus the directory
+// signatures of any glob patterns registered via UpdateGlob. It is
+// marshalled into DIRENV_WATCHES so that a later invocation can tell
+// whether anything .envrc depends on has changed since it was loaded.
+type FileTimes struct {
+	files map[string]time.Time
+	globs map[string]string
+}
+
+func NewFileTimes() FileTimes {
+	return FileTimes{
+		files: make(map[string]time.Time),
+		globs: make(map[string]string),
+	}
+}
+
+func (times FileTimes) Marshal() string {
+	parts := make([]string, 0)
+	for path, t := range times.files {
+		parts = append(parts, path+"__"+strconv.FormatInt(t.UnixNano(), 10))
+	}
+	for pattern, sig := range times.globs {
+		parts = append(parts, "glob:"+pattern+"__"+sig)
+	}
+	return strings.Join(parts, "__")
+}
+
+func (times *FileTimes) Unmarshal(marshalled string) {
+	*times = NewFileTimes()
+	tokens := strings.Split(marshalled, "__")
+	tokenCount := len(tokens)
+
+	for i := 0; i+1 < tokenCount; i += 2 {
+		key := tokens[i]
+		value := tokens[i+1]
+
+		if pattern := strings.TrimPrefix(key, "glob:"); pattern != key {
+			times.globs[pattern] = value
+			continue
+		}
+
+		nanoseconds, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			times.files[key] = time.Unix(0, nanoseconds)
+		}
+	}
+}
+
+// Update records the current mtime of path, so that a later Load can
+// detect it disappearing, being recreated, or being touched.
+func (times FileTimes) Update(path string) {
+	stat, err := os.Stat(path)
+	var mtime time.Time
+	if err == nil {
+		mtime = stat.ModTime()
+	}
+
+	times.files[path] = mtime
+}
+
+// UpdateGlob registers a wildcard pattern such as "config/*.yaml",
+// expanded relative to workDir, and records a signature covering every
+// path it currently matches plus each one's mtime. Unlike Update, this
+// lets HasChanged notice files being added to or removed from the
+// pattern, not just modifications to files already known about.
+func (times FileTimes) UpdateGlob(pattern, workDir string) error {
+	sig, err := globSignature(pattern, workDir)
+	if err != nil {
+		return err
+	}
+	times.globs[pattern] = sig
+	return nil
+}
+
+// HasChanged reports whether any tracked file's mtime, or any tracked
+// glob's directory signature, no longer matches what was last recorded.
+func (times FileTimes) HasChanged(workDir string) bool {
+	for path, lastMtime := range times.files {
+		stat, err := os.Stat(path)
+
+		var mtime time.Time
+		if err == nil {
+			mtime = stat.ModTime()
+		}
+
+		if mtime != lastMtime {
+			return true
+		}
+	}
+
+	for pattern, lastSig := range times.globs {
+		sig, err := globSignature(pattern, workDir)
+		if err != nil || sig != lastSig {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globSignature expands pattern (relative to workDir unless it is
+// already absolute) and hashes the sorted list of matches together
+// with each match's mtime, so that additions, removals and
+// modifications all change the result.
+func globSignature(pattern, workDir string) (string, error) {
+	full := pattern
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(workDir, pattern)
+	}
+
+	matches, err := filepath.Glob(full)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(matches)
+
+	hasher := sha256.New()
+	for _, match := range matches {
+		stat, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(hasher, "%s\n%d\n", match, stat.ModTime().UnixNano())
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTimesHasChangedDetectsGlobAddRemoveModify(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "direnv-filetimes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := ioutil.WriteFile(filepath.Join(workDir, "a.yaml"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	times := NewFileTimes()
+	if err := times.UpdateGlob("*.yaml", workDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if times.HasChanged(workDir) {
+		t.Fatal("HasChanged reported a change with nothing touched since UpdateGlob")
+	}
+
+	// adding a file matching the pattern should be noticed
+	if err := ioutil.WriteFile(filepath.Join(workDir, "b.yaml"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !times.HasChanged(workDir) {
+		t.Fatal("HasChanged missed a new file matching the glob")
+	}
+	if err := times.UpdateGlob("*.yaml", workDir); err != nil {
+		t.Fatal(err)
+	}
+	if times.HasChanged(workDir) {
+		t.Fatal("HasChanged reported a change right after re-recording the signature")
+	}
+
+	// modifying a matched file's mtime should be noticed
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(workDir, "a.yaml"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !times.HasChanged(workDir) {
+		t.Fatal("HasChanged missed a modified file still matching the glob")
+	}
+	if err := times.UpdateGlob("*.yaml", workDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// removing a matched file should be noticed
+	if err := os.Remove(filepath.Join(workDir, "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if !times.HasChanged(workDir) {
+		t.Fatal("HasChanged missed a file removed from the glob")
+	}
+}
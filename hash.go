@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+)
+
+// Hasher is a digest algorithm identified by a 1-byte code.
+// encodeMultihash combines that code, a 1-byte length and the raw
+// digest into a self-describing value. Encoding the code alongside
+// the digest lets an allow file declare which algorithm produced it,
+// so users can switch Config.HashAlgorithm without invalidating every
+// approval they've already made under the old one.
+type Hasher interface {
+	// Code is the 1-byte algorithm identifier stored in the multihash.
+	Code() byte
+	// Sum hashes data and returns the raw digest (no code/length prefix).
+	Sum(data []byte) []byte
+}
+
+const (
+	hashCodeSHA256 byte = 0x01
+	hashCodeSHA512 byte = 0x02
+	hashCodeBLAKE3 byte = 0x03
+)
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Code() byte { return hashCodeSHA256 }
+func (sha256Hasher) Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+type sha512Hasher struct{}
+
+func (sha512Hasher) Code() byte { return hashCodeSHA512 }
+func (sha512Hasher) Sum(data []byte) []byte {
+	sum := sha512.Sum512(data)
+	return sum[:]
+}
+
+// hashers is keyed by the name users write into Config.HashAlgorithm.
+var hashers = map[string]Hasher{
+	"sha256": sha256Hasher{},
+	"sha512": sha512Hasher{},
+}
+
+// hashersByCode lets us go the other way: given the code byte decoded
+// from an allow file's name, find the Hasher that can re-verify it.
+// BLAKE3 is deliberately left unregistered here -- there's no stdlib
+// implementation, so selectHasher returns an error for it rather than
+// silently substituting another algorithm; a build-tagged variant can
+// register it later.
+var hashersByCode = map[byte]Hasher{
+	hashCodeSHA256: sha256Hasher{},
+	hashCodeSHA512: sha512Hasher{},
+}
+
+// selectHasher resolves Config.HashAlgorithm (empty means "sha256") to
+// a concrete Hasher, erroring out on anything we don't know how to
+// produce rather than silently downgrading.
+func selectHasher(name string) (Hasher, error) {
+	if name == "" {
+		name = "sha256"
+	}
+	if h, ok := hashers[name]; ok {
+		return h, nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q", name)
+}
+
+// encodeMultihash renders code + len(digest) + digest as a base58
+// string suitable for use as a filename under config.AllowDir().
+func encodeMultihash(code byte, digest []byte) string {
+	raw := make([]byte, 0, len(digest)+2)
+	raw = append(raw, code, byte(len(digest)))
+	raw = append(raw, digest...)
+	return base58Encode(raw)
+}
+
+// decodeMultihash is the inverse of encodeMultihash. It returns
+// ok=false for anything that isn't validly-formed, so callers can
+// treat a garbled or foreign filename as "not a multihash" rather than
+// erroring.
+func decodeMultihash(encoded string) (code byte, digest []byte, ok bool) {
+	raw, err := base58Decode(encoded)
+	if err != nil || len(raw) < 2 {
+		return 0, nil, false
+	}
+
+	code = raw[0]
+	length := int(raw[1])
+	if len(raw) != length+2 {
+		return 0, nil, false
+	}
+
+	return code, raw[2:], true
+}
+
+// fileHash hashes path+"\n"+contents with the given Hasher and returns
+// the multihash-encoded, base58 filename that RCFromPath stores it
+// under. This replaces the old hard-coded-sha256-as-hex scheme; see
+// legacyFileHash for reading allow files written before the switch.
+func fileHash(path string, hasher Hasher, fs Filesystem) (hash string, err error) {
+	digest, err := hashDigest(path, hasher, fs)
+	if err != nil {
+		return
+	}
+	return encodeMultihash(hasher.Code(), digest), nil
+}
+
+// hashDigest is fileHash without the multihash encoding, so callers
+// that already have a Hasher picked out (eg. by decoding an existing
+// allow filename's code byte) can re-derive the raw digest to compare
+// against, instead of having to re-encode a filename to compare strings.
+func hashDigest(path string, hasher Hasher, fs Filesystem) (digest []byte, err error) {
+	if path, err = canonicalizePath(path, fs); err != nil {
+		return
+	}
+
+	fd, err := fs.Open(path)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	contents, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return
+	}
+
+	return hasher.Sum(append([]byte(path+"\n"), contents...)), nil
+}
+
+// legacyFileHash reproduces the bare-hex sha256(path+"\n"+contents)
+// scheme direnv used before allow files became self-describing, so
+// approvals made by older direnv versions keep working.
+func legacyFileHash(path string, fs Filesystem) (hash string, err error) {
+	if path, err = canonicalizePath(path, fs); err != nil {
+		return
+	}
+
+	fd, err := fs.Open(path)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	hasher := sha256.New()
+	hasher.Write([]byte(path + "\n"))
+	if _, err = io.Copy(hasher, fd); err != nil {
+		return
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var base58Radix = big.NewInt(58)
+
+func base58Encode(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base58Radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+
+	// leading zero bytes carry no value, so the loop above never
+	// produces a digit for them -- give each one its own '1' directly
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	// reverse
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	x := new(big.Int)
+	for _, c := range s[zeros:] {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		x.Mul(x, base58Radix)
+		x.Add(x, big.NewInt(int64(digit)))
+	}
+
+	decoded := x.Bytes()
+	result := make([]byte, zeros, zeros+len(decoded))
+	return append(result, decoded...), nil
+}
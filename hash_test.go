@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBase58RoundTrip(t *testing.T) {
+	cases := [][]byte{
+		{0},
+		{0, 0, 0},
+		{1, 2, 3},
+		{0, 1, 2, 3},
+		[]byte("hello, direnv"),
+	}
+
+	for _, data := range cases {
+		encoded := base58Encode(data)
+		decoded, err := base58Decode(encoded)
+		if err != nil {
+			t.Fatalf("base58Decode(%q) returned %v", encoded, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("base58 round trip of % x: got % x", data, decoded)
+		}
+	}
+}
+
+func TestMultihashRoundTrip(t *testing.T) {
+	digest := sha256Hasher{}.Sum([]byte("contents"))
+
+	encoded := encodeMultihash(hashCodeSHA256, digest)
+	code, decoded, ok := decodeMultihash(encoded)
+	if !ok {
+		t.Fatalf("decodeMultihash(%q) reported not ok", encoded)
+	}
+	if code != hashCodeSHA256 {
+		t.Fatalf("decodeMultihash code = %#x, want %#x", code, hashCodeSHA256)
+	}
+	if !bytes.Equal(decoded, digest) {
+		t.Fatalf("decodeMultihash digest = % x, want % x", decoded, digest)
+	}
+}
+
+func TestDecodeMultihashRejectsGarbage(t *testing.T) {
+	if _, _, ok := decodeMultihash("not-a-multihash-0OIl"); ok {
+		t.Fatal("decodeMultihash accepted a string with invalid base58 characters")
+	}
+}
@@ -0,0 +1,84 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// watcher is a minimal inotify wrapper: callers Add() directories and
+// receive a coalesced tick on Events() whenever anything in one of
+// them changes. We don't need per-event detail, just "something
+// changed, go re-evaluate".
+type watcher struct {
+	fd     int
+	file   *os.File
+	events chan struct{}
+	mu     sync.Mutex
+	wds    map[int32]string
+}
+
+func newWatcher() (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+		wds:    make(map[int32]string),
+	}
+	go w.readLoop()
+	return w, nil
+}
+
+func (w *watcher) Add(dir string) error {
+	mask := uint32(syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO)
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, mask)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.wds[int32(wd)] = dir
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *watcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *watcher) Close() error {
+	return w.file.Close()
+}
+
+const inotifyEventSize = syscall.SizeofInotifyEvent
+
+func (w *watcher) readLoop() {
+	buf := make([]byte, 64*(inotifyEventSize+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			close(w.events)
+			return
+		}
+
+		offset := 0
+		for offset+inotifyEventSize <= n {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += inotifyEventSize + int(raw.Len)
+
+			select {
+			case w.events <- struct{}{}:
+			default:
+				// a tick is already pending, no need to queue another
+			}
+		}
+	}
+}
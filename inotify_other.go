@@ -0,0 +1,17 @@
+// +build !linux
+
+package main
+
+import "fmt"
+
+// watcher has no implementation outside Linux; watch-daemon isn't
+// supported there yet.
+type watcher struct{}
+
+func newWatcher() (*watcher, error) {
+	return nil, fmt.Errorf("watch-daemon requires inotify support (Linux only)")
+}
+
+func (w *watcher) Add(dir string) error   { return nil }
+func (w *watcher) Events() <-chan struct{} { return nil }
+func (w *watcher) Close() error           { return nil }
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,19 +15,25 @@ type RC struct {
 	allowPath string
 	times     FileTimes
 	config    *Config
+	fs        Filesystem
 }
 
-func FindRC(wd string, config *Config) *RC {
-	rcPath := findUp(wd, ".envrc")
+func FindRC(wd string, config *Config, fs Filesystem) *RC {
+	rcPath := findUp(wd, ".envrc", fs)
 	if rcPath == "" {
 		return nil
 	}
 
-	return RCFromPath(rcPath, config)
+	return RCFromPath(rcPath, config, fs)
 }
 
-func RCFromPath(path string, config *Config) *RC {
-	hash, err := fileHash(path)
+func RCFromPath(path string, config *Config, fs Filesystem) *RC {
+	hasher, err := selectHasher(config.HashAlgorithm)
+	if err != nil {
+		return nil
+	}
+
+	hash, err := fileHash(path, hasher, fs)
 	if err != nil {
 		return nil
 	}
@@ -40,23 +44,27 @@ func RCFromPath(path string, config *Config) *RC {
 	times.Update(path)
 	times.Update(allowPath)
 
-	return &RC{path, allowPath, times, config}
+	return &RC{path, allowPath, times, config, fs}
 }
 
-func RCFromEnv(path, marshalled_times string, config *Config) *RC {
+func RCFromEnv(path, marshalled_times string, config *Config, fs Filesystem) *RC {
 	times := NewFileTimes()
 	times.Unmarshal(marshalled_times)
-	return &RC{path, "", times, config}
+	return &RC{path, "", times, config, fs}
 }
 
 func (rc *RC) Allow() (err error) {
+	if rc.config.TrustBackend == "xattr" {
+		return xattrAllow(rc.path)
+	}
+
 	if rc.allowPath == "" {
 		return fmt.Errorf("cannot allow empty path")
 	}
 	if err = os.MkdirAll(filepath.Dir(rc.allowPath), 0755); err != nil {
 		return
 	}
-	if err = allow(rc.path, rc.allowPath); err != nil {
+	if err = allow(rc.path, rc.allowPath, rc.fs); err != nil {
 		return
 	}
 	rc.times.Update(rc.allowPath)
@@ -64,19 +72,62 @@ func (rc *RC) Allow() (err error) {
 }
 
 func (rc *RC) Deny() error {
+	if rc.config.TrustBackend == "xattr" {
+		return xattrDeny(rc.path)
+	}
+
 	return os.Remove(rc.allowPath)
 }
 
 func (rc *RC) Allowed() bool {
-	// happy path is if this envrc has been explicitly allowed, O(1)ish common case
-	_, err := os.Stat(rc.allowPath)
+	// the xattr backend stores trust metadata directly on the .envrc
+	// file instead of under config.AllowDir(), so it doesn't
+	// accumulate stale allow files and survives the repo moving to
+	// another machine along with its attrs. Fall through to the
+	// regular AllowDir/whitelist checks if it says no, since a repo
+	// may have been approved under the other backend previously.
+	if rc.config.TrustBackend == "xattr" && xattrAllowed(rc.path) {
+		return true
+	}
 
-	if err == nil {
+	// happy path is if this envrc has been explicitly allowed, O(1)ish common case
+	if fileExists(rc.allowPath, rc.fs) {
 		return true
 	}
 
+	// the allow file may have been written under a different algorithm
+	// than the one Config currently selects. Decode each candidate
+	// filename's code byte, re-hash with whatever Hasher that code
+	// names, and compare digests directly -- an unknown code just
+	// won't match anything in hashersByCode and falls through.
+	if entries, err := rc.fs.ReadDir(rc.config.AllowDir()); err == nil {
+		for _, entry := range entries {
+			code, digest, ok := decodeMultihash(entry.Name())
+			if !ok {
+				continue
+			}
+
+			hasher, ok := hashersByCode[code]
+			if !ok {
+				continue
+			}
+
+			if actual, err := hashDigest(rc.path, hasher, rc.fs); err == nil && bytes.Equal(actual, digest) {
+				return true
+			}
+		}
+	}
+
+	// compatibility shim for allow files written before multihash
+	// encoding, when fileHash was always bare-hex sha256
+	if legacyHash, err := legacyFileHash(rc.path, rc.fs); err == nil {
+		if fileExists(filepath.Join(rc.config.AllowDir(), legacyHash), rc.fs) {
+			return true
+		}
+	}
+
 	// when whitelisting we want to be (path) absolutely sure we've not been duped with a symlink
-	path, err := filepath.Abs(rc.path)
+	path, err := canonicalizePath(rc.path, rc.fs)
 	// seems unlikely that we'd hit this, but have to handle it
 	if err != nil {
 		return false
@@ -94,6 +145,13 @@ func (rc *RC) Allowed() bool {
 		}
 	}
 
+	// last resort: a detached .envrc.sig signed by a key under
+	// config.ConfigDir()/trusted_keys/ lets a team commit trust once
+	// instead of every machine running `direnv allow` individually
+	if verifySignature(rc.path, rc.config) == nil {
+		return true
+	}
+
 	return false
 }
 
@@ -113,12 +171,33 @@ func (rc *RC) RelTo(wd string) string {
 }
 
 func (rc *RC) Touch() error {
-	return touch(rc.path)
+	return touch(rc.path, rc.fs)
 }
 
 const NOT_ALLOWED = "%s is blocked. Run `direnv allow` to approve its content"
 
 func (rc *RC) Load(config *Config, env Env) (newEnv Env, err error) {
+	// ask the watch-daemon (if one is running) for an env it already
+	// evaluated for this exact .envrc content before spawning bash ourselves
+	if hash, hashErr := legacyFileHash(rc.path, rc.fs); hashErr == nil {
+		if cached, ok := requestCachedEnv(config.WorkDir, hash); ok {
+			return rc.LoadCached(config, env, cached)
+		}
+	}
+
+	return rc.load(config, env, nil)
+}
+
+// LoadCached behaves exactly like Load, except that when dumped is
+// non-nil it's applied directly instead of spawning bash. This is how
+// the watch-daemon's pre-evaluated env (see daemon.go) gets applied on
+// a cache hit, while still running Allowed() and RecordState the same
+// way a live Load would.
+func (rc *RC) LoadCached(config *Config, env Env, dumped Env) (newEnv Env, err error) {
+	return rc.load(config, env, dumped)
+}
+
+func (rc *RC) load(config *Config, env Env, dumped Env) (newEnv Env, err error) {
 	wd := config.WorkDir
 	direnv := config.SelfPath
 	newEnv = env.Copy()
@@ -129,6 +208,20 @@ func (rc *RC) Load(config *Config, env Env) (newEnv Env, err error) {
 
 	if !rc.Allowed() {
 		err = fmt.Errorf(NOT_ALLOWED, rc.RelTo(wd))
+		// verifySignature's error already distinguishes "no signature"
+		// from "signed by an untrusted key" -- surface it so the user
+		// knows whether to run `direnv allow`, `direnv sign`, or
+		// `direnv trust-key`, instead of always pointing at `allow`
+		if sigErr := verifySignature(rc.path, rc.config); sigErr != nil {
+			err = fmt.Errorf("%s (%s)", err, sigErr)
+		}
+		return
+	}
+
+	if dumped != nil {
+		for key, value := range dumped {
+			newEnv[key] = value
+		}
 		return
 	}
 
@@ -207,47 +300,92 @@ func eachDir(path string) (paths []string) {
 	return
 }
 
-func fileExists(path string) bool {
-	_, err := os.Stat(path)
+func fileExists(path string, fs Filesystem) bool {
+	_, err := fs.Stat(path)
 	return err == nil
 }
 
-func fileHash(path string) (hash string, err error) {
-	if path, err = filepath.Abs(path); err != nil {
-		return
-	}
-
-	fd, err := os.Open(path)
-	if err != nil {
-		return
-	}
-
-	hasher := sha256.New()
-	hasher.Write([]byte(path + "\n"))
-	if _, err = io.Copy(hasher, fd); err != nil {
-		return
-	}
-
-	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
-}
-
 // Creates a file
 
-func touch(path string) (err error) {
+func touch(path string, fs Filesystem) (err error) {
 	t := time.Now()
-	return os.Chtimes(path, t, t)
+	return fs.Chtimes(path, t, t)
 }
 
-func allow(path string, allowPath string) (err error) {
-	return ioutil.WriteFile(allowPath, []byte(path+"\n"), 0644)
+func allow(path string, allowPath string, fs Filesystem) (err error) {
+	return fs.WriteFile(allowPath, []byte(path+"\n"), 0644)
 }
 
-func findUp(searchDir string, fileName string) (path string) {
+func findUp(searchDir string, fileName string, fs Filesystem) (path string) {
 	for _, dir := range eachDir(searchDir) {
+		// resolve symlinks encountered while walking up, so a .envrc
+		// reachable via two different symlinked directories still
+		// canonicalizes to the same path and gets exactly one allow entry
+		if resolved, err := canonicalizePath(dir, fs); err == nil {
+			dir = resolved
+		}
 		path = filepath.Join(dir, fileName)
-		if fileExists(path) {
+		if fileExists(path, fs) {
 			return
 		}
 	}
 	return ""
 }
+
+// maxSymlinkDepth bounds the recursion in canonicalizePath, the same
+// way filepath.EvalSymlinks bounds its own loop, so a symlink cycle
+// errors out instead of recursing forever.
+const maxSymlinkDepth = 255
+
+// canonicalizePath resolves every symlink in path's component chain,
+// through fs so it works against whatever Filesystem a Config names
+// rather than always the local disk. Unlike filepath.EvalSymlinks, it
+// tolerates a final component that doesn't exist yet by returning its
+// parent fully resolved and the rest of the path untouched.
+func canonicalizePath(path string, fs Filesystem) (string, error) {
+	return canonicalizePathDepth(path, fs, 0)
+}
+
+func canonicalizePathDepth(path string, fs Filesystem, depth int) (string, error) {
+	if depth > maxSymlinkDepth {
+		return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(abs, string(filepath.Separator))
+	resolved := string(filepath.Separator)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		info, err := fs.Lstat(next)
+		if err != nil {
+			// this and every remaining component don't exist on disk
+			// yet, so there's nothing further to resolve
+			return filepath.Join(append([]string{resolved}, parts[i:]...)...), nil
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		target, err := fs.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		resolved, err = canonicalizePathDepth(target, fs, depth+1)
+		if err != nil {
+			return "", err
+		}
+	}
+	return resolved, nil
+}
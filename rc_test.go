@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// This is the attack canonicalizePath exists to close: an attacker
+// plants their own .envrc under /tmp/evil, then symlinks it in from a
+// directory that happens to match a WhitelistPrefix entry. Without
+// resolving the symlink, RC.Allowed would compare the whitelisted
+// symlink path instead of where the content actually lives.
+func TestCanonicalizePathResolvesWhitelistedSymlink(t *testing.T) {
+	base, err := ioutil.TempDir("", "direnv-canonicalize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	evilDir := filepath.Join(base, "evil")
+	if err := os.Mkdir(evilDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	evilEnvrc := filepath.Join(evilDir, ".envrc")
+	if err := ioutil.WriteFile(evilEnvrc, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	whitelistedDir := filepath.Join(base, "whitelisted")
+	if err := os.Symlink(evilDir, whitelistedDir); err != nil {
+		t.Fatal(err)
+	}
+	viaWhitelistedSymlink := filepath.Join(whitelistedDir, ".envrc")
+
+	resolved, err := canonicalizePath(viaWhitelistedSymlink, LocalFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved != evilEnvrc {
+		t.Fatalf("canonicalizePath(%q) = %q, want %q", viaWhitelistedSymlink, resolved, evilEnvrc)
+	}
+
+	// reaching the same file through a second symlink must canonicalize
+	// to the same path, so it gets exactly one allow entry rather than one per route
+	otherDir := filepath.Join(base, "other-route")
+	if err := os.Symlink(evilDir, otherDir); err != nil {
+		t.Fatal(err)
+	}
+	viaOtherSymlink := filepath.Join(otherDir, ".envrc")
+
+	resolvedOther, err := canonicalizePath(viaOtherSymlink, LocalFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolvedOther != resolved {
+		t.Fatalf("canonicalizePath gave different results for two symlinked routes to the same file: %q vs %q", resolved, resolvedOther)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// signingKeyPath is where `direnv sign` keeps the ed25519 private key
+// it generates on first use.
+func signingKeyPath(config *Config) string {
+	return filepath.Join(config.ConfigDir(), "signing_key")
+}
+
+// trustedKeysDir holds one file per trusted public key, named however
+// `direnv trust-key` was told to name it; the filename has no meaning
+// to verifySignature, which just tries every key in the directory.
+func trustedKeysDir(config *Config) string {
+	return filepath.Join(config.ConfigDir(), "trusted_keys")
+}
+
+// signPath signs path's contents with the local signing key,
+// generating one first if this is the first time `direnv sign` has
+// run, and writes the detached signature to path+".sig".
+func signPath(path string, config *Config) error {
+	key, err := loadOrCreateSigningKey(config)
+	if err != nil {
+		return err
+	}
+
+	message, err := signedMessage(path)
+	if err != nil {
+		return err
+	}
+
+	sig := ed25519.Sign(key, message)
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	return ioutil.WriteFile(path+".sig", []byte(encoded+"\n"), 0644)
+}
+
+// signedMessage is what actually gets signed/verified: the canonical
+// path plus contents, the same binding hashDigest uses, so a
+// legitimately-signed .envrc can't be copied or symlinked into another
+// directory and auto-trusted there.
+func signedMessage(path string) ([]byte, error) {
+	canonical, err := canonicalizePath(path, LocalFS)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(canonical+"\n"), contents...), nil
+}
+
+func loadOrCreateSigningKey(config *Config) (ed25519.PrivateKey, error) {
+	keyPath := signingKeyPath(config)
+
+	if data, err := ioutil.ReadFile(keyPath); err == nil {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(raw) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("%s does not contain a valid signing key", keyPath)
+		}
+		return ed25519.PrivateKey(raw), nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(priv)
+	if err := ioutil.WriteFile(keyPath, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, err
+	}
+
+	return priv, nil
+}
+
+// publicKeyForSigningKey returns the base64-encoded public half of the
+// local signing key, for `direnv sign` to print so it can be handed to
+// a teammate for `direnv trust-key`.
+func publicKeyForSigningKey(config *Config) (string, error) {
+	key, err := loadOrCreateSigningKey(config)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// verifySignature loads path+".sig" and checks it against every key
+// under trustedKeysDir. It returns a nil error only when a trusted key
+// verifies; the error otherwise distinguishes "no .sig file at all"
+// from "there's a signature, but no trusted key produced it", so
+// RC.Allowed's caller can tell the user which one applies.
+func verifySignature(path string, config *Config) error {
+	sigData, err := ioutil.ReadFile(path + ".sig")
+	if err != nil {
+		return fmt.Errorf("no signature found (expected %s.sig)", path)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return fmt.Errorf("%s.sig is malformed", path)
+	}
+
+	message, err := signedMessage(path)
+	if err != nil {
+		return err
+	}
+
+	keys, err := loadTrustedKeys(config)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if ed25519.Verify(key, message, sig) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s is signed, but not by a trusted key -- run `direnv trust-key` to add the signer's public key", path)
+}
+
+func loadTrustedKeys(config *Config) ([]ed25519.PublicKey, error) {
+	dir := trustedKeysDir(config)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	keys := make([]ed25519.PublicKey, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			continue
+		}
+
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+
+	return keys, nil
+}
+
+// trustKey saves publicKey under trustedKeysDir as name, so
+// verifySignature will accept signatures it produced.
+func trustKey(config *Config, name, publicKey string) error {
+	if filepath.Base(name) != name {
+		return fmt.Errorf("%q is not a valid key name", name)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey)); err != nil {
+		return fmt.Errorf("%q is not a valid base64-encoded public key", publicKey)
+	}
+
+	dir := trustedKeysDir(config)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(strings.TrimSpace(publicKey)+"\n"), 0644)
+}
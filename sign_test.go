@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// signedMessage binds the signed message to the canonical path, not
+// just the contents -- otherwise a legitimately-signed .envrc could be
+// copied or symlinked into another directory and verify there too.
+func TestSignedMessageBindsToPath(t *testing.T) {
+	base, err := ioutil.TempDir("", "direnv-sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	pathA := filepath.Join(base, "a", ".envrc")
+	pathB := filepath.Join(base, "b", ".envrc")
+	for _, p := range []string{pathA, pathB} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("export FOO=bar\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messageA, err := signedMessage(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageB, err := signedMessage(pathB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(messageA, messageB) {
+		t.Fatal("signedMessage produced identical messages for identical contents at two different paths")
+	}
+}
+
+func TestTrustKeyRejectsPathTraversalNames(t *testing.T) {
+	config := &Config{}
+
+	for _, name := range []string{"../evil", "../../etc/passwd", "a/b"} {
+		if err := trustKey(config, name, "AAAA"); err == nil {
+			t.Fatalf("trustKey accepted a path-traversal name %q", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	xattrHashName     = "user.direnv.hash"
+	xattrHashTimeName = "user.direnv.hashtime"
+)
+
+// xattrAllow stamps path with its trust metadata: the sha256 of
+// path+"\n"+contents, and the mtime the file had at approval time.
+// Allowed() treats a mismatch on either as untrusted, same as a
+// missing xattr.
+func xattrAllow(path string) error {
+	hash, err := legacyFileHash(path, LocalFS)
+	if err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err := setXattr(path, xattrHashName, []byte(hash)); err != nil {
+		return err
+	}
+	mtime := strconv.FormatInt(stat.ModTime().UnixNano(), 10)
+	return setXattr(path, xattrHashTimeName, []byte(mtime))
+}
+
+// xattrDeny removes the trust xattrs direnv wrote, if any.
+func xattrDeny(path string) error {
+	if err := removeXattr(path, xattrHashName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := removeXattr(path, xattrHashTimeName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// xattrAllowed reports whether path carries trust xattrs that are
+// still valid: the mtime xattr must match the file's current mtime
+// (so editing after approval un-trusts it), and the hash xattr must
+// re-verify against the current contents.
+func xattrAllowed(path string) bool {
+	hashBytes, err := getXattr(path, xattrHashName)
+	if err != nil {
+		return false
+	}
+
+	mtimeBytes, err := getXattr(path, xattrHashTimeName)
+	if err != nil {
+		return false
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	storedNanos, err := strconv.ParseInt(string(mtimeBytes), 10, 64)
+	if err != nil {
+		return false
+	}
+	if !time.Unix(0, storedNanos).Equal(stat.ModTime()) {
+		return false
+	}
+
+	hash, err := legacyFileHash(path, LocalFS)
+	if err != nil {
+		return false
+	}
+
+	return hash == string(hashBytes)
+}
+
+var errXattrUnsupported = fmt.Errorf("xattr trust backend is not supported on this platform")
@@ -0,0 +1,39 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func setXattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	// Most direnv metadata values are tiny (a hash, a timestamp); grow
+	// once if a future value ever doesn't fit.
+	buf := make([]byte, 256)
+	n, err := syscall.Getxattr(path, name, buf)
+	if err == syscall.ERANGE {
+		if n, err = syscall.Getxattr(path, name, nil); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, n)
+		n, err = syscall.Getxattr(path, name, buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func removeXattr(path, name string) error {
+	err := syscall.Removexattr(path, name)
+	if err == syscall.ENODATA {
+		// the attribute isn't set; report it as a plain "does not exist"
+		return os.ErrNotExist
+	}
+	return err
+}
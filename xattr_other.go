@@ -0,0 +1,15 @@
+// +build !linux
+
+package main
+
+func setXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+func removeXattr(path, name string) error {
+	return errXattrUnsupported
+}
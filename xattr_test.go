@@ -0,0 +1,51 @@
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestXattrAllowRoundTrip(t *testing.T) {
+	f, err := ioutil.TempFile("", "direnv-xattr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	if err := ioutil.WriteFile(path, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := xattrAllow(path); err != nil {
+		if os.IsPermission(err) || err == errXattrUnsupported {
+			t.Skipf("xattrs not usable on this filesystem: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	if !xattrAllowed(path) {
+		t.Fatal("xattrAllowed is false right after xattrAllow")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("export FOO=baz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if xattrAllowed(path) {
+		t.Fatal("xattrAllowed is true after the contents changed")
+	}
+
+	if err := xattrAllow(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := xattrDeny(path); err != nil {
+		t.Fatal(err)
+	}
+	if xattrAllowed(path) {
+		t.Fatal("xattrAllowed is true after xattrDeny")
+	}
+}